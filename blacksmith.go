@@ -1,9 +1,28 @@
 package blacksmith
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
 	"github.com/mgagliardo91/go-utils"
 )
 
+// Default durations used for the staged Stop teardown when the caller hasn't
+// overridden them.
+const (
+	defaultTimeoutDispatch = 2 * time.Second
+	defaultTimeoutWorkers  = 5 * time.Second
+	defaultTimeoutFinal    = 2 * time.Second
+)
+
+// defaultMaxAttempts is how many times a task is retried after the worker
+// running it crashes, before Blacksmith gives up on it.
+const defaultMaxAttempts = 3
+
 // TaskName is an enumeration of jobs to execute
 type TaskName int
 
@@ -14,10 +33,32 @@ type Task struct {
 	Payload interface{} `json:"payload"`
 	// TaskName identifies the type of task
 	TaskName TaskName `json:"taskName"`
+	// TaskID uniquely identifies this task, assigned when it's queued so it
+	// can be returned from QueueTask/QueueTaskContext and later used to look
+	// up its captured log via Blacksmith.TaskLog.
+	TaskID string `json:"taskId"`
+
+	// report, when set, lets Progress send a status message back to the
+	// Blacksmith running this task. It's wired up by the worker handling the
+	// task and is nil for a Task built outside of one (e.g. in a test).
+	report func(kind statusKind, detail string, err error)
+}
+
+// Progress reports incremental progress for this task back to the
+// Blacksmith that dispatched it, e.g. for long-running handlers that want
+// to surface status before they finish. It's a no-op if the task isn't
+// currently running under a Blacksmith.
+func (t Task) Progress(detail string) {
+	if t.report != nil {
+		t.report(statusProgress, detail, nil)
+	}
 }
 
-// TaskHandler is a function used to execute a type of task
-type TaskHandler func(task Task)
+// TaskHandler is a function used to execute a type of task. The context is
+// derived from the Blacksmith's lifetime and is cancelled by Stop once the
+// dispatcher stage of shutdown is over, allowing handlers to observe
+// cancellation and return early.
+type TaskHandler func(ctx context.Context, task Task)
 
 // Worker works on a goroutine to carry out a Task
 type Worker struct {
@@ -26,31 +67,157 @@ type Worker struct {
 	taskChannel chan Task
 	stopChannel utils.StopChannel
 	executeTask TaskHandler
+	wg          *sync.WaitGroup
+	done        chan struct{}
+	taskLogs    *taskLogStore
+	smith       *Blacksmith
 }
 
 // Blacksmith is in charge of splitting and dispatching work to workers
 type Blacksmith struct {
 	LogProvider
+	ctx         context.Context
+	cancel      context.CancelFunc
 	taskQueue   chan Task
 	workerPool  chan chan Task
 	maxWorkers  int
 	stopChannel utils.StopChannel
+	stopping    chan struct{}
+	stopOnce    sync.Once
 	workers     []Worker
-	handlerMap  map[TaskName]TaskHandler
-	handlerFn   TaskHandler
+	workersWg   sync.WaitGroup
+
+	// dispatchWg tracks the per-job goroutines dispatch spawns to hand a
+	// dequeued job to a worker. Stop waits on it before telling workers to
+	// quit, so a job already off taskQueue but still mid-handoff can't lose
+	// its race against a worker's stop signal and get silently dropped.
+	dispatchWg sync.WaitGroup
+	handlerMap map[TaskName]TaskHandler
+	handlerFn  TaskHandler
+
+	timeoutDispatch time.Duration
+	timeoutWorkers  time.Duration
+	timeoutFinal    time.Duration
+
+	logHandler Handler
+	logLevel   Level
+
+	taskLogCap  int
+	maxTaskLogs int
+	taskLogs    *taskLogStore
+
+	maxAttempts  int
+	capabilities []TaskName
+
+	channelOwner map[chan Task]string
+
+	sessionsMu sync.Mutex
+	sessions   map[string]*workerSession
+
+	assignMu    sync.Mutex
+	assignments map[string]*assignment
+
+	statusCh chan statusMsg
+	events   chan Event
+
+	// queueDepth counts tasks that have been sent on taskQueue but not yet
+	// handed to a worker by dispatch; taskQueue itself is unbuffered, so its
+	// len is always 0 and can't tell Stats anything.
+	queueDepth int64
+}
+
+// Option configures optional behavior when constructing a Blacksmith via New.
+type Option func(*Blacksmith)
+
+// WithHandler sets the Handler that sinks every Record produced by this
+// Blacksmith and the Workers/Tasks it creates. Defaults to the package root
+// handler (logfmt to stdout).
+func WithHandler(handler Handler) Option {
+	return func(b *Blacksmith) {
+		b.logHandler = handler
+	}
+}
+
+// WithLevel filters out Records below level. Defaults to LevelInfo.
+func WithLevel(level Level) Option {
+	return func(b *Blacksmith) {
+		b.logLevel = level
+	}
+}
+
+// WithTaskLogCapacity sets how many of the most recent log lines each task
+// retains in memory for retrieval via TaskLog/StreamTaskLog. Defaults to
+// 100.
+func WithTaskLogCapacity(n int) Option {
+	return func(b *Blacksmith) {
+		b.taskLogCap = n
+	}
+}
+
+// WithMaxTaskLogs bounds how many tasks' logs are retained at once; the
+// least-recently-touched task's log is evicted once the cap is exceeded.
+// Defaults to 1000.
+func WithMaxTaskLogs(n int) Option {
+	return func(b *Blacksmith) {
+		b.maxTaskLogs = n
+	}
+}
+
+// WithMaxAttempts bounds how many times a task is retried after the worker
+// executing it crashes, before Blacksmith gives up and emits an
+// EventTaskFailed on Events(). Defaults to 3.
+func WithMaxAttempts(n int) Option {
+	return func(b *Blacksmith) {
+		b.maxAttempts = n
+	}
+}
+
+// WithCapabilities declares the TaskNames every worker in this Blacksmith
+// can accept. It's recorded on each worker's session for introspection via
+// Stats. Defaults to nil, meaning a worker accepts any task.
+func WithCapabilities(capabilities ...TaskName) Option {
+	return func(b *Blacksmith) {
+		b.capabilities = capabilities
+	}
 }
 
 // New generates a Blacksmith in charge of creating/dividing tasks
-func New(maxWorkers int) *Blacksmith {
+func New(maxWorkers int, opts ...Option) *Blacksmith {
+	ctx, cancel := context.WithCancel(context.Background())
+
 	blacksmith := Blacksmith{
-		taskQueue:   make(chan Task),
-		workerPool:  make(chan chan Task, maxWorkers),
-		maxWorkers:  maxWorkers,
-		stopChannel: utils.NewStopChannel(),
-		workers:     make([]Worker, maxWorkers),
-		handlerMap:  make(map[TaskName]TaskHandler),
+		ctx:             ctx,
+		cancel:          cancel,
+		taskQueue:       make(chan Task),
+		workerPool:      make(chan chan Task, maxWorkers),
+		maxWorkers:      maxWorkers,
+		stopChannel:     utils.NewStopChannel(),
+		stopping:        make(chan struct{}),
+		workers:         make([]Worker, maxWorkers),
+		handlerMap:      make(map[TaskName]TaskHandler),
+		timeoutDispatch: defaultTimeoutDispatch,
+		timeoutWorkers:  defaultTimeoutWorkers,
+		timeoutFinal:    defaultTimeoutFinal,
+		logHandler:      rootHandler,
+		logLevel:        LevelInfo,
+		taskLogCap:      defaultTaskLogCapacity,
+		maxTaskLogs:     defaultMaxTaskLogs,
+		maxAttempts:     defaultMaxAttempts,
+		channelOwner:    make(map[chan Task]string, maxWorkers),
+		sessions:        make(map[string]*workerSession),
+		assignments:     make(map[string]*assignment),
+		statusCh:        make(chan statusMsg, defaultStatusBuffer),
+		events:          make(chan Event, defaultEventBuffer),
+	}
+
+	for _, opt := range opts {
+		opt(&blacksmith)
 	}
+
 	blacksmith.InitLog("Blacksmith")
+	blacksmith.SetLogger(NewLogger(NewLevelFilterHandler(blacksmith.logLevel, blacksmith.logHandler)).With("component", "blacksmith"))
+	blacksmith.taskLogs = newTaskLogStore(blacksmith.taskLogCap, blacksmith.maxTaskLogs)
+
 	return &blacksmith
 }
 
@@ -66,90 +233,267 @@ func (b *Blacksmith) SetHandler(taskName TaskName, taskHandler TaskHandler) *Bla
 	return b
 }
 
+// SetShutdownTimeouts overrides the durations used by the staged teardown in
+// Stop: timeoutDispatch bounds how long the dispatcher keeps handing out
+// already-queued jobs, timeoutWorkers bounds how long running handlers get to
+// return once their task context is cancelled, and timeoutFinal bounds the
+// grace period before any still-running handler is abandoned.
+func (b *Blacksmith) SetShutdownTimeouts(timeoutDispatch, timeoutWorkers, timeoutFinal time.Duration) *Blacksmith {
+	b.timeoutDispatch = timeoutDispatch
+	b.timeoutWorkers = timeoutWorkers
+	b.timeoutFinal = timeoutFinal
+	return b
+}
+
 // Run starts the Blacksmith which will initialize the workers
 func (b *Blacksmith) Run() *Blacksmith {
-	b.LogfUsing(GetLogger().Tracef, "Starting %v workers\n", b.maxWorkers)
+	b.Logger().Debug("starting workers", "count", b.maxWorkers)
 	for i := 0; i < b.maxWorkers; i++ {
 		worker := Worker{
 			workerPool:  b.workerPool,
 			taskChannel: make(chan Task),
 			stopChannel: utils.NewStopChannel(),
+			wg:          &b.workersWg,
+			done:        make(chan struct{}),
+			taskLogs:    b.taskLogs,
+			smith:       b,
 		}
 		worker.InitLog("worker").SetPrefix(b.Identifier())
-		worker.start(b.executeTask)
+		worker.SetLogger(b.Logger().With("worker", worker.Identifier()))
+		b.channelOwner[worker.taskChannel] = worker.Identifier()
+		b.workersWg.Add(1)
+		worker.start(b.ctx, b.executeTask)
 		b.workers[i] = worker
 	}
 
 	b.Log("Blacksmith started.")
 	go b.dispatch()
+	go b.processStatus()
 
 	return b
 }
 
-// Stop shuts down the Blacksmith which will wait for all workers to complete
-func (b *Blacksmith) Stop() *Blacksmith {
-	b.LogUsing(GetLogger().Trace, "Received request to stop")
-	b.stopChannel.RequestStop()
-	b.Log("Blacksmith stopped.")
+// ErrAlreadyStopping is returned by Stop when it's called more than once,
+// whether or not the first call has finished tearing down.
+var ErrAlreadyStopping = errors.New("blacksmith: stop already requested")
+
+// Stop shuts down the Blacksmith in bounded stages: it stops accepting new
+// tasks, gives the dispatcher timeoutDispatch to hand out anything already
+// queued, cancels the shared task context and gives workers timeoutWorkers to
+// return, then waits up to timeoutFinal before abandoning any handler still
+// running. It blocks until teardown completes or is abandoned, and returns an
+// error naming the workers that were leaked. Only the first call actually
+// tears anything down; later calls return ErrAlreadyStopping immediately.
+func (b *Blacksmith) Stop(ctx context.Context) error {
+	first := false
+	b.stopOnce.Do(func() {
+		first = true
+		b.Logger().Debug("received request to stop")
+		close(b.stopping)
+	})
+	if !first {
+		return ErrAlreadyStopping
+	}
+
+	// Cancelling is safe to defer unconditionally: it must run on every exit
+	// path, including a ctx.Done() return from the select below, and
+	// context.CancelFunc tolerates being called more than once.
+	defer b.cancel()
+
+	requested := make(chan struct{})
+	go func() {
+		b.stopChannel.RequestStop()
+		close(requested)
+	}()
+
+	select {
+	case <-requested:
+	case <-time.After(b.timeoutDispatch):
+		b.Logger().Warn("timed out waiting for dispatcher to drain queue")
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	b.cancel()
+
+	if b.waitWorkers(minDuration(b.timeoutWorkers, remaining(ctx))) {
+		b.Log("Blacksmith stopped.")
+		return nil
+	}
+
+	if b.waitWorkers(minDuration(b.timeoutFinal, remaining(ctx))) {
+		b.Log("Blacksmith stopped.")
+		return nil
+	}
+
+	leaked := b.leakedWorkers()
+	b.Logger().Error("abandoning workers still running at shutdown", "count", len(leaked), "workers", leaked)
+	return fmt.Errorf("blacksmith: stop abandoned %d worker(s) still running: %v", len(leaked), leaked)
+}
+
+// Wait blocks until the Blacksmith has stopped naturally, i.e. until a
+// concurrent call to Stop has completed teardown of every worker.
+func (b *Blacksmith) Wait() {
+	b.workersWg.Wait()
+}
+
+func (b *Blacksmith) waitWorkers(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		b.workersWg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// waitDispatch blocks until every in-flight per-job dispatch goroutine has
+// handed its job off to a worker, or timeout elapses, whichever comes
+// first. It returns false if the timeout won the race.
+func (b *Blacksmith) waitDispatch(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		b.dispatchWg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+func (b *Blacksmith) leakedWorkers() []string {
+	leaked := make([]string, 0, len(b.workers))
+	for _, worker := range b.workers {
+		select {
+		case <-worker.done:
+		default:
+			leaked = append(leaked, worker.Identifier())
+		}
+	}
+	return leaked
+}
+
+func remaining(ctx context.Context) time.Duration {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return time.Duration(1<<63 - 1)
+	}
+	return time.Until(deadline)
+}
+
+func minDuration(a, b time.Duration) time.Duration {
+	if a < b {
+		return a
+	}
 	return b
 }
 
-// QueueTask adds a new task to the work queue
-func (b *Blacksmith) QueueTask(taskName TaskName, payload interface{}) {
-	b.taskQueue <- Task{TaskName: taskName, Payload: payload}
+// QueueTask adds a new task to the work queue using the Blacksmith's own
+// context, returning the id assigned to the task. See QueueTaskContext for a
+// version that accepts a caller-supplied context.
+func (b *Blacksmith) QueueTask(taskName TaskName, payload interface{}) (string, error) {
+	return b.QueueTaskContext(b.ctx, taskName, payload)
+}
+
+// QueueTaskContext adds a new task to the work queue, returning the id
+// assigned to the task, or an error if the Blacksmith is stopping or the
+// supplied context is cancelled before the task can be queued.
+func (b *Blacksmith) QueueTaskContext(ctx context.Context, taskName TaskName, payload interface{}) (string, error) {
+	taskID, _ := sid.Generate()
+	task := Task{Payload: payload, TaskName: taskName, TaskID: taskID}
+
+	select {
+	case b.taskQueue <- task:
+		atomic.AddInt64(&b.queueDepth, 1)
+		return taskID, nil
+	case <-b.stopping:
+		return "", fmt.Errorf("blacksmith: cannot queue task %v, smith is stopping", taskName)
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
 }
 
 func (b *Blacksmith) dispatch() {
 	for {
 		select {
 		case job := <-b.taskQueue:
+			b.dispatchWg.Add(1)
 			go func(job Task) {
+				defer b.dispatchWg.Done()
+
 				taskChannel := <-b.workerPool
+				atomic.AddInt64(&b.queueDepth, -1)
+				workerID := b.channelOwner[taskChannel]
+				attempt := b.recordAssignment(job.TaskID, workerID)
 
-				b.LogfUsing(GetLogger().Tracef, "Dispatching Task: %+v\n", job)
+				b.Logger().Debug("dispatching task", "task", job.TaskName, "worker", workerID, "attempt", attempt)
 				taskChannel <- job
 			}(job)
 		case <-b.stopChannel.OnRequest:
 			go func() {
-				b.LogUsing(GetLogger().Trace, "Closing all workers")
+				b.Logger().Debug("waiting for in-flight task handoffs")
+				if !b.waitDispatch(b.timeoutDispatch) {
+					b.Logger().Warn("timed out waiting for in-flight task handoffs before stopping workers")
+				}
+
+				b.Logger().Debug("closing all workers")
 				for _, worker := range b.workers {
 					worker.stop()
 				}
-				b.LogUsing(GetLogger().Trace, "Quitting")
+				b.Logger().Debug("quitting")
 				b.stopChannel.Stop()
 			}()
 		}
 	}
 }
 
-func (b *Blacksmith) executeTask(task Task) {
+func (b *Blacksmith) executeTask(ctx context.Context, task Task) {
 	if b.handlerFn != nil {
-		b.handlerFn(task)
+		b.handlerFn(ctx, task)
 		return
 	}
 
 	t := b.handlerMap[task.TaskName]
 
 	if t != nil {
-		t(task)
+		t(ctx, task)
 	} else {
-		b.LogfUsing(GetLogger().Tracef, "Cannot locate task handler for task name: %s", task.TaskName)
+		b.Logger().Warn("no handler registered for task", "task", task.TaskName)
 	}
 }
 
-func (worker Worker) start(taskHandler TaskHandler) {
-	worker.LogUsing(GetLogger().Trace, "Started")
+func (worker Worker) start(ctx context.Context, taskHandler TaskHandler) {
+	worker.Logger().Debug("started")
+
+	workerID := worker.Identifier()
+	if worker.smith != nil {
+		worker.smith.registerSession(workerID, worker.smith.capabilities)
+	}
+
 	go func() {
+		defer worker.wg.Done()
+		defer close(worker.done)
+		if worker.smith != nil {
+			defer worker.smith.deregisterSession(workerID)
+		}
+
 		for {
 			worker.workerPool <- worker.taskChannel
 
 			select {
 			case task := <-worker.taskChannel:
-				task.InitLog("Task").SetPrefix(worker.Identifier())
-				worker.LogfUsing(GetLogger().Tracef, "Processing task %+v\n", task)
-				taskHandler(task)
+				worker.run(ctx, task, taskHandler)
 			case <-worker.stopChannel.OnRequest:
-				worker.LogUsing(GetLogger().Trace, "Quitting")
+				worker.Logger().Debug("quitting")
 				worker.stopChannel.Stop()
 				return
 			}
@@ -157,6 +501,60 @@ func (worker Worker) start(taskHandler TaskHandler) {
 	}()
 }
 
+// run prepares task's per-task logger, acknowledges it over the session
+// status channel, and executes taskHandler. A panicking handler is
+// recovered here so the worker's goroutine survives; the crash is reported
+// to the owning Blacksmith, which re-queues the task up to MaxAttempts
+// before giving up on it.
+func (worker Worker) run(ctx context.Context, task Task, taskHandler TaskHandler) {
+	workerID := worker.Identifier()
+
+	tl := worker.taskLogs.create(task.TaskID)
+	task.InitLogWithID("Task", task.TaskID).SetPrefix(workerID)
+	task.SetLogger(worker.taskLogger(task, tl))
+	worker.Logger().Debug("processing task", "task", task.TaskName, "task_id", task.TaskID)
+
+	if worker.smith != nil {
+		task.report = func(kind statusKind, detail string, err error) {
+			worker.smith.sendStatus(statusMsg{workerID: workerID, taskID: task.TaskID, kind: kind, detail: detail, err: err})
+		}
+		task.report(statusAck, "", nil)
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err := fmt.Errorf("panic: %v", r)
+			worker.Logger().Error("task handler panicked", "task", task.TaskName, "task_id", task.TaskID, "error", err)
+
+			if worker.smith != nil {
+				task.report(statusFailed, "", err)
+				worker.smith.handleTaskFailure(task, err)
+			}
+		}
+	}()
+
+	taskHandler(ctx, task)
+
+	if worker.smith != nil {
+		task.report(statusDone, "", nil)
+		worker.smith.completeAssignment(task.TaskID)
+	}
+}
+
 func (worker Worker) stop() {
 	worker.stopChannel.RequestStop()
 }
+
+// taskLogger returns a Logger for task that carries the worker's own
+// context (component/worker fields) plus task/task_id, and tees every
+// Record it produces into tl alongside the worker's regular handler.
+func (worker Worker) taskLogger(task Task, tl *taskLog) Logger {
+	withTask := worker.Logger().With("task", task.TaskName, "task_id", task.TaskID)
+
+	sl, ok := withTask.(*stdLogger)
+	if !ok {
+		return withTask
+	}
+
+	return &stdLogger{ctx: sl.ctx, handler: newMultiHandler(sl.handler, tl)}
+}
@@ -0,0 +1,135 @@
+package blacksmith
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestStopIsSafeToCallTwice guards against a regression where a second Stop
+// call panicked on close of an already-closed stopping channel. It mirrors a
+// plausible caller: retry Stop after it reports a timeout, or call it from
+// both a signal handler and application code.
+func TestStopIsSafeToCallTwice(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+
+	b := New(1)
+	b.SetShutdownTimeouts(5*time.Millisecond, 5*time.Millisecond, 5*time.Millisecond)
+	b.SetHandlerFn(func(ctx context.Context, task Task) {
+		<-block
+	})
+	b.Run()
+
+	if _, err := b.QueueTask(TaskName(0), nil); err != nil {
+		t.Fatalf("QueueTask: %v", err)
+	}
+	time.Sleep(20 * time.Millisecond) // let dispatch hand the task to the worker
+
+	if err := b.Stop(context.Background()); err == nil {
+		t.Fatal("expected first Stop to report the still-running worker")
+	}
+
+	if err := b.Stop(context.Background()); err != ErrAlreadyStopping {
+		t.Fatalf("expected second Stop to return ErrAlreadyStopping, got %v", err)
+	}
+}
+
+// TestStopCancelsContextWhenCallerContextDoneFirst guards against a
+// regression where returning via ctx.Done() skipped b.cancel(), leaving the
+// Blacksmith's internal task context un-cancelled forever. Run is
+// deliberately not called, so nothing ever drains the dispatcher's stop
+// request and the ctx.Done() branch is the only one that can fire.
+func TestStopCancelsContextWhenCallerContextDoneFirst(t *testing.T) {
+	b := New(1)
+	b.SetShutdownTimeouts(time.Second, time.Second, time.Second)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := b.Stop(ctx); err != context.Canceled {
+		t.Fatalf("expected Stop to return ctx.Err(), got %v", err)
+	}
+
+	select {
+	case <-b.ctx.Done():
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("expected Blacksmith's internal context to be cancelled")
+	}
+}
+
+// TestStopWaitsForInFlightDispatchHandoff guards against a regression where
+// a task already popped off taskQueue, but still racing a per-job goroutine
+// to reach a worker, could be silently dropped: dispatch's stop branch told
+// every worker to quit with no synchronization against those in-flight
+// handoffs, so a worker's own select could pick the stop signal over the
+// pending task send, leaking the per-job goroutine and losing the task
+// while Stop still reported success.
+//
+// With a single worker, this queues task A (which the worker picks up and
+// blocks on), then task B, which dispatch pulls off taskQueue but can't yet
+// hand off since the worker is busy - exactly the in-flight handoff window
+// the bug was in. Stop is then called concurrently with releasing A, which
+// is when the worker frees up and the handoff race used to be lost.
+func TestStopWaitsForInFlightDispatchHandoff(t *testing.T) {
+	var mu sync.Mutex
+	var executed []string
+
+	releaseA := make(chan struct{})
+
+	b := New(1)
+	b.SetShutdownTimeouts(200*time.Millisecond, 200*time.Millisecond, 200*time.Millisecond)
+	b.SetHandlerFn(func(ctx context.Context, task Task) {
+		if task.Payload == "A" {
+			<-releaseA
+		}
+		mu.Lock()
+		executed = append(executed, task.TaskID)
+		mu.Unlock()
+	})
+	b.Run()
+
+	idA, err := b.QueueTask(TaskName(0), "A")
+	if err != nil {
+		t.Fatalf("QueueTask(A): %v", err)
+	}
+	time.Sleep(20 * time.Millisecond) // let the worker pick up A and block on releaseA
+
+	idB, err := b.QueueTask(TaskName(0), "B")
+	if err != nil {
+		t.Fatalf("QueueTask(B): %v", err)
+	}
+	time.Sleep(20 * time.Millisecond) // let dispatch pull B off taskQueue onto the in-flight handoff goroutine
+
+	stopErr := make(chan error, 1)
+	go func() { stopErr <- b.Stop(context.Background()) }()
+	time.Sleep(20 * time.Millisecond) // let Stop start tearing down while A is still in flight
+	close(releaseA)
+
+	if err := <-stopErr; err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(executed) != 2 || !containsAll(executed, idA, idB) {
+		t.Fatalf("expected both tasks to execute, got %v (want %s and %s)", executed, idA, idB)
+	}
+}
+
+func containsAll(haystack []string, wants ...string) bool {
+	for _, want := range wants {
+		found := false
+		for _, got := range haystack {
+			if got == want {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
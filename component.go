@@ -0,0 +1,48 @@
+package blacksmith
+
+import (
+	"context"
+	"time"
+
+	"github.com/mgagliardo91/blacksmith/run"
+)
+
+// component adapts a Blacksmith to run.Component so it can be coordinated by
+// a run.Group alongside other long-running pieces of a larger program.
+type component struct {
+	b           *Blacksmith
+	stopTimeout time.Duration
+}
+
+// AsComponent adapts b to run.Component. Its GracefulStop calls b.Stop with
+// a context bounded by stopTimeout.
+func (b *Blacksmith) AsComponent(stopTimeout time.Duration) run.Component {
+	return &component{b: b, stopTimeout: stopTimeout}
+}
+
+// Name implements run.Component.
+func (c *component) Name() string {
+	return c.b.Identifier()
+}
+
+// PreRun implements run.Component. Blacksmith has no cross-component wiring
+// to do, so this is a no-op.
+func (c *component) PreRun() error {
+	return nil
+}
+
+// Serve implements run.Component by starting the Blacksmith and blocking
+// until it stops.
+func (c *component) Serve() error {
+	c.b.Run()
+	c.b.Wait()
+	return nil
+}
+
+// GracefulStop implements run.Component by stopping the Blacksmith, bounded
+// by the timeout it was adapted with.
+func (c *component) GracefulStop() {
+	ctx, cancel := context.WithTimeout(context.Background(), c.stopTimeout)
+	defer cancel()
+	c.b.Stop(ctx)
+}
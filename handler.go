@@ -0,0 +1,158 @@
+package blacksmith
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const timeFormat = "2006-01-02T15:04:05.000Z07:00"
+
+// Handler processes a single Record, typically by writing it to a sink.
+// Handlers must be safe for concurrent use, since Loggers sharing a Handler
+// may be written to from multiple workers at once.
+type Handler interface {
+	Log(r Record) error
+}
+
+// HandlerFunc adapts a plain function to the Handler interface.
+type HandlerFunc func(r Record) error
+
+// Log calls fn(r).
+func (fn HandlerFunc) Log(r Record) error {
+	return fn(r)
+}
+
+// LevelFilterHandler wraps another Handler and drops any Record below level
+// before it reaches it.
+type LevelFilterHandler struct {
+	level Level
+	next  Handler
+}
+
+// NewLevelFilterHandler returns a Handler that only forwards Records at or
+// above level to next.
+func NewLevelFilterHandler(level Level, next Handler) Handler {
+	return &LevelFilterHandler{level: level, next: next}
+}
+
+// Log implements Handler.
+func (h *LevelFilterHandler) Log(r Record) error {
+	if r.Level < h.level {
+		return nil
+	}
+	return h.next.Log(r)
+}
+
+// LogfmtHandler writes each Record to w as a single logfmt-style line, e.g.
+// `t=... level=info msg="task queued" worker=worker-ab12 task=1`.
+type LogfmtHandler struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewLogfmtHandler returns a Handler that writes logfmt lines to w.
+func NewLogfmtHandler(w io.Writer) Handler {
+	return &LogfmtHandler{w: w}
+}
+
+// Log implements Handler.
+func (h *LogfmtHandler) Log(r Record) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	_, err := fmt.Fprintln(h.w, formatLogfmt(r))
+	return err
+}
+
+func formatLogfmt(r Record) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "t=%s level=%s msg=%q", r.Time.Format(timeFormat), r.Level, r.Msg)
+	if r.Call.File != "" {
+		fmt.Fprintf(&b, " caller=%s:%d", filepath.Base(r.Call.File), r.Call.Line)
+	}
+	for i := 0; i+1 < len(r.Ctx); i += 2 {
+		fmt.Fprintf(&b, " %v=%s", r.Ctx[i], formatLogfmtValue(r.Ctx[i+1]))
+	}
+
+	return b.String()
+}
+
+func formatLogfmtValue(v interface{}) string {
+	s := fmt.Sprintf("%v", v)
+	if strings.ContainsAny(s, " \t\"=") {
+		return fmt.Sprintf("%q", s)
+	}
+	return s
+}
+
+// JSONHandler writes each Record to w as a single line of newline-delimited
+// JSON, mirroring LogfmtHandler's fields.
+type JSONHandler struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewJSONHandler returns a Handler that writes newline-delimited JSON to w.
+func NewJSONHandler(w io.Writer) Handler {
+	return &JSONHandler{w: w}
+}
+
+type jsonRecord struct {
+	Time   string                 `json:"time"`
+	Level  string                 `json:"level"`
+	Msg    string                 `json:"msg"`
+	Caller string                 `json:"caller,omitempty"`
+	Fields map[string]interface{} `json:"fields,omitempty"`
+}
+
+// Log implements Handler.
+func (h *JSONHandler) Log(r Record) error {
+	jr := jsonRecord{
+		Time:   r.Time.Format(timeFormat),
+		Level:  r.Level.String(),
+		Msg:    r.Msg,
+		Fields: make(map[string]interface{}, len(r.Ctx)/2),
+	}
+	if r.Call.File != "" {
+		jr.Caller = fmt.Sprintf("%s:%d", filepath.Base(r.Call.File), r.Call.Line)
+	}
+	for i := 0; i+1 < len(r.Ctx); i += 2 {
+		jr.Fields[fmt.Sprintf("%v", r.Ctx[i])] = r.Ctx[i+1]
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return json.NewEncoder(h.w).Encode(jr)
+}
+
+// multiHandler fans a Record out to every Handler in the slice, continuing
+// past any that returns an error so one broken sink can't swallow a Record
+// destined for the others.
+type multiHandler []Handler
+
+// newMultiHandler returns a Handler that forwards every Record to each of
+// hs. nil entries are skipped, so callers can compose handlers that may or
+// may not be present (e.g. an optional per-task ring buffer).
+func newMultiHandler(hs ...Handler) Handler {
+	return multiHandler(hs)
+}
+
+// Log implements Handler.
+func (hs multiHandler) Log(r Record) error {
+	var firstErr error
+	for _, h := range hs {
+		if h == nil {
+			continue
+		}
+		if err := h.Log(r); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
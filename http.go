@@ -0,0 +1,52 @@
+package blacksmith
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// HTTPHandler returns an http.Handler serving GET /tasks/{id}/log as
+// newline-delimited JSON, mirroring Harbor's per-job log download endpoint.
+func (b *Blacksmith) HTTPHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		taskID := taskIDFromLogPath(r.URL.Path)
+		if taskID == "" {
+			http.NotFound(w, r)
+			return
+		}
+
+		records, err := b.TaskLog(taskID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		enc := json.NewEncoder(w)
+		for _, record := range records {
+			if err := enc.Encode(record); err != nil {
+				return
+			}
+		}
+	})
+}
+
+// taskIDFromLogPath extracts {id} from a "/tasks/{id}/log" path, returning
+// "" if the path doesn't match that shape.
+func taskIDFromLogPath(path string) string {
+	if !strings.HasPrefix(path, "/tasks/") || !strings.HasSuffix(path, "/log") {
+		return ""
+	}
+
+	id := strings.TrimSuffix(strings.TrimPrefix(path, "/tasks/"), "/log")
+	if id == "" || strings.Contains(id, "/") {
+		return ""
+	}
+	return id
+}
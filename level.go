@@ -0,0 +1,38 @@
+package blacksmith
+
+import "encoding/json"
+
+// Level represents the severity of a log Record, ordered from most to least
+// verbose so that handlers such as LevelFilterHandler can compare them
+// directly.
+type Level int
+
+// The supported log levels, in increasing order of severity.
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+// String returns the lowercase name used by LogfmtHandler and JSONHandler.
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	default:
+		return "unknown"
+	}
+}
+
+// MarshalJSON renders Level as its lowercase name rather than the underlying
+// int, matching the text produced by LogfmtHandler and JSONHandler.
+func (l Level) MarshalJSON() ([]byte, error) {
+	return json.Marshal(l.String())
+}
@@ -1,103 +1,109 @@
 package blacksmith
 
 import (
-	"fmt"
-
-	"github.com/mgagliardo91/go-utils"
-
-	"github.com/teris-io/shortid"
+	"os"
+	"runtime"
+	"time"
 )
 
-// LoggerName is the name used by blacksmith for logging
+// LoggerName is attached as logger=<LoggerName> to every Record written
+// through the package root Logger, i.e. by a LogProvider that hasn't been
+// given its own Logger via SetLogger.
 const LoggerName = "blacksmith-logger"
 
-// LogFormatFn overloads the logging GetLogger().fmt(string, format)
-type LogFormatFn func(string, ...interface{})
-
-// LogFn overloads the standard GetLogger().xx()
-type LogFn func(...interface{})
-
-// LogProvider represents an entity that can GetLogger(). All logged statements will be formatted
-// with the identity of the LogProvider
-type LogProvider struct {
-	id     string
-	name   string
-	prefix string
+// Logger emits leveled, structured log Records. Each call to With returns a
+// child Logger that prepends the given key/value pairs to every Record it
+// produces, without mutating the receiver - mirroring the log15/go-kit
+// pattern of accumulating context as it's handed down (Blacksmith -> Worker
+// -> Task).
+type Logger interface {
+	Debug(msg string, keyvals ...interface{})
+	Info(msg string, keyvals ...interface{})
+	Warn(msg string, keyvals ...interface{})
+	Error(msg string, keyvals ...interface{})
+	With(keyvals ...interface{}) Logger
 }
 
-var sid, _ = shortid.New(1, shortid.DefaultABC, 2342)
-var logger *utils.LogWrapper
+// rootHandler is the default sink used by a Blacksmith built without
+// WithHandler.
+var rootHandler Handler = NewLogfmtHandler(os.Stdout)
 
-// InitLog initializes the LogProvider
-func (lP *LogProvider) InitLog(name string) *LogProvider {
-	lP.name = name
-	lP.id, _ = sid.Generate()
+// rootLogger is the default Logger handed to a LogProvider until something
+// overrides it with SetLogger, e.g. a Task created outside of a running
+// Blacksmith.
+var rootLogger Logger = NewLogger(rootHandler).With("logger", LoggerName)
 
-	return lP
-}
+// callerSkip is the runtime.Caller depth, measured from inside write, that
+// reaches the code calling a Logger method (Debug/Info/Warn/Error) directly.
+const callerSkip = 2
 
-// SetPrefix passes a parent identity that will be logged at the start of each GetLogger() statement
-func (lP *LogProvider) SetPrefix(prefix string) *LogProvider {
-	lP.prefix = prefix
-	return lP
+// stdLogger is the default Logger implementation, backed by a Handler.
+type stdLogger struct {
+	ctx     []interface{}
+	handler Handler
 }
 
-// Identifier returns a A-ID|B-ID|C-ID pattern for the LogProvider
-func (lP LogProvider) Identifier() string {
-	identifier := lP._identifier()
-
-	if lP.prefix != "" {
-		identifier = fmt.Sprintf("%s>%s", lP.prefix, identifier)
-	}
-
-	return identifier
+// NewLogger returns a Logger that sends every Record it produces to handler.
+func NewLogger(handler Handler) Logger {
+	return &stdLogger{handler: handler}
 }
 
-func (lP LogProvider) _identifier() string {
-	return fmt.Sprintf("%s-%s", lP.name, lP.id)
+// With implements Logger.
+func (l *stdLogger) With(keyvals ...interface{}) Logger {
+	ctx := make([]interface{}, 0, len(l.ctx)+len(keyvals))
+	ctx = append(ctx, l.ctx...)
+	ctx = append(ctx, keyvals...)
+	return &stdLogger{ctx: ctx, handler: l.handler}
 }
 
-func (lP LogProvider) buildLogPrefix() string {
-	logStatement := fmt.Sprintf("[%s]:", lP._identifier())
-
-	if lP.prefix != "" {
-		logStatement = fmt.Sprintf("(%s) %s", lP.prefix, logStatement)
-	}
-
-	return logStatement
+// Debug implements Logger.
+func (l *stdLogger) Debug(msg string, keyvals ...interface{}) {
+	l.write(LevelDebug, msg, keyvals, callerSkip)
 }
 
-// Logf prints the value and arguments using the standard GetLogger().Printf
-func (lP LogProvider) Logf(value string, args ...interface{}) {
-	lP.LogfUsing(GetLogger().Printf, value, args...)
+// Info implements Logger.
+func (l *stdLogger) Info(msg string, keyvals ...interface{}) {
+	l.write(LevelInfo, msg, keyvals, callerSkip)
 }
 
-// LogfUsing prints the value and arguments using the provided LogFormatFn
-func (lP LogProvider) LogfUsing(logFn LogFormatFn, value string, args ...interface{}) {
-	logStatement := fmt.Sprintf("%s %s", lP.buildLogPrefix(), value)
-	logFn(logStatement, args)
+// Warn implements Logger.
+func (l *stdLogger) Warn(msg string, keyvals ...interface{}) {
+	l.write(LevelWarn, msg, keyvals, callerSkip)
 }
 
-// Log prints the value and arguments using the standard GetLogger().Println
-func (lP LogProvider) Log(value string) {
-	lP.LogUsing(GetLogger().Println, value)
+// Error implements Logger.
+func (l *stdLogger) Error(msg string, keyvals ...interface{}) {
+	l.write(LevelError, msg, keyvals, callerSkip)
 }
 
-// LogUsing prints the value and arguments using the provided LogFn
-func (lP LogProvider) LogUsing(logFn LogFn, value string, args ...interface{}) {
-	logStatement := fmt.Sprintf("%s %s", lP.buildLogPrefix(), value)
+// shimLog is used by LogProvider's deprecated Log/Logf/LogUsing/LogfUsing
+// methods so the captured caller is whatever called into the shim, not the
+// shim itself. Reaching that caller means skipping past two extra frames
+// those methods add on top of a direct Logger call: the deprecated method
+// itself (e.g. LogProvider.Log) and the shim helper it routes through.
+func (l *stdLogger) shimLog(level Level, msg string, keyvals []interface{}) {
+	l.write(level, msg, keyvals, callerSkip+2)
+}
 
-	if len(args) > 0 {
-		logFn(logStatement, args)
-	} else {
-		logFn(logStatement)
+func (l *stdLogger) write(level Level, msg string, keyvals []interface{}, skip int) {
+	if l.handler == nil {
+		return
 	}
-}
 
-func GetLogger() *utils.LogWrapper {
-	if logger == nil {
-		logger = utils.NewLogger(LoggerName)
+	ctx := make([]interface{}, 0, len(l.ctx)+len(keyvals))
+	ctx = append(ctx, l.ctx...)
+	ctx = append(ctx, keyvals...)
+
+	var call CallerInfo
+	if _, file, line, ok := runtime.Caller(skip); ok {
+		call = CallerInfo{File: file, Line: line}
 	}
 
-	return logger
+	l.handler.Log(Record{
+		Time:  time.Now(),
+		Level: level,
+		Msg:   msg,
+		Ctx:   ctx,
+		Call:  call,
+	})
 }
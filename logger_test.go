@@ -0,0 +1,96 @@
+package blacksmith
+
+import (
+	"bytes"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// TestLogProviderLogCapturesCallSite guards against a regression where the
+// deprecated LogProvider.Log/Logf/LogUsing/LogfUsing methods reported a
+// caller inside the shim itself instead of the code that actually called
+// them.
+func TestLogProviderLogCapturesCallSite(t *testing.T) {
+	var got Record
+	handler := HandlerFunc(func(r Record) error {
+		got = r
+		return nil
+	})
+
+	lp := LogProvider{}
+	lp.InitLog("test")
+	lp.SetLogger(NewLogger(handler))
+
+	_, wantFile, wantLine, _ := runtime.Caller(0)
+	lp.Log("hello") // wantLine must stay on the line above this call
+	wantLine++
+
+	if filepath.Base(got.Call.File) != filepath.Base(wantFile) {
+		t.Fatalf("expected caller file %s, got %s", wantFile, got.Call.File)
+	}
+	if got.Call.Line != wantLine {
+		t.Fatalf("expected caller line %d, got %d", wantLine, got.Call.Line)
+	}
+}
+
+// TestLogfmtHandlerConcurrentLogging exercises the doc comment's claim on
+// Handler that "Handlers must be safe for concurrent use, since Loggers
+// sharing a Handler may be written to from multiple workers at once" - the
+// exact situation every Worker's logger is in, since they all share the
+// Blacksmith's handler. Run with -race to catch a torn write.
+func TestLogfmtHandlerConcurrentLogging(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(NewLogfmtHandler(&buf))
+
+	const goroutines = 20
+	const perGoroutine = 50
+
+	var wg sync.WaitGroup
+	wg.Add(goroutines)
+	for i := 0; i < goroutines; i++ {
+		go func(i int) {
+			defer wg.Done()
+			child := logger.With("worker", i)
+			for j := 0; j < perGoroutine; j++ {
+				child.Info("tick", "n", j)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	lines := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+	if len(lines) != goroutines*perGoroutine {
+		t.Fatalf("expected %d log lines, got %d", goroutines*perGoroutine, len(lines))
+	}
+	for _, line := range lines {
+		if !strings.Contains(line, "msg=\"tick\"") || !strings.Contains(line, "worker=") {
+			t.Fatalf("expected a well-formed, non-interleaved logfmt line, got %q", line)
+		}
+	}
+}
+
+// TestLevelFilterHandlerDropsBelowLevel checks that a Logger backed by a
+// LevelFilterHandler forwards only Records at or above the filter's level.
+func TestLevelFilterHandlerDropsBelowLevel(t *testing.T) {
+	var got []Record
+	sink := HandlerFunc(func(r Record) error {
+		got = append(got, r)
+		return nil
+	})
+
+	logger := NewLogger(NewLevelFilterHandler(LevelWarn, sink))
+	logger.Debug("should be dropped")
+	logger.Info("should also be dropped")
+	logger.Warn("should pass")
+	logger.Error("should also pass")
+
+	if len(got) != 2 {
+		t.Fatalf("expected only Warn and Error records to pass the filter, got %d: %v", len(got), got)
+	}
+	if got[0].Msg != "should pass" || got[1].Msg != "should also pass" {
+		t.Fatalf("unexpected records passed the filter: %v", got)
+	}
+}
@@ -0,0 +1,139 @@
+package blacksmith
+
+import (
+	"fmt"
+
+	"github.com/teris-io/shortid"
+)
+
+// LogFn is the function signature used by the pre-structured-logging
+// LogUsing API. Deprecated: kept only for source compatibility.
+type LogFn func(...interface{})
+
+// LogFormatFn is the function signature used by the pre-structured-logging
+// LogfUsing API. Deprecated: kept only for source compatibility.
+type LogFormatFn func(string, ...interface{})
+
+// LogProvider represents an entity that carries a Logger. Embedding it gives
+// a type an Identifier() and a Logger(). InitLog starts it on the package
+// root Logger; SetLogger replaces that with one carrying the type's fields.
+type LogProvider struct {
+	id     string
+	name   string
+	prefix string
+	logger Logger
+}
+
+var sid, _ = shortid.New(1, shortid.DefaultABC, 2342)
+
+// InitLog initializes the LogProvider, assigning it a short id and the
+// package root Logger. Callers that want their own fields attached (e.g.
+// Blacksmith adding component=blacksmith) should follow up with SetLogger.
+func (lP *LogProvider) InitLog(name string) *LogProvider {
+	lP.name = name
+	lP.id, _ = sid.Generate()
+	lP.logger = rootLogger
+
+	return lP
+}
+
+// InitLogWithID initializes the LogProvider like InitLog, but uses id
+// instead of generating a new one. Used for Tasks, whose id is already
+// fixed at QueueTaskContext time so Blacksmith.TaskLog can look it up later.
+func (lP *LogProvider) InitLogWithID(name, id string) *LogProvider {
+	lP.name = name
+	lP.id = id
+	lP.logger = rootLogger
+
+	return lP
+}
+
+// SetPrefix passes a parent identity that is included in Identifier().
+func (lP *LogProvider) SetPrefix(prefix string) *LogProvider {
+	lP.prefix = prefix
+	return lP
+}
+
+// SetLogger overrides the Logger used by this LogProvider, typically with a
+// child obtained via Logger().With(...).
+func (lP *LogProvider) SetLogger(l Logger) *LogProvider {
+	lP.logger = l
+	return lP
+}
+
+// Logger returns the structured Logger scoped to this LogProvider.
+func (lP LogProvider) Logger() Logger {
+	return lP.logger
+}
+
+// Identifier returns "name-id" for the LogProvider, preceded by "prefix>"
+// when a prefix has been set.
+func (lP LogProvider) Identifier() string {
+	identifier := lP._identifier()
+
+	if lP.prefix != "" {
+		identifier = fmt.Sprintf("%s>%s", lP.prefix, identifier)
+	}
+
+	return identifier
+}
+
+func (lP LogProvider) _identifier() string {
+	return fmt.Sprintf("%s-%s", lP.name, lP.id)
+}
+
+// Log routes value to Logger().Info.
+//
+// Deprecated: call Logger().Info directly; Log is kept so code written
+// against the pre-structured-logging API keeps compiling.
+func (lP LogProvider) Log(value string) {
+	lP.shim(LevelInfo, value, nil)
+}
+
+// Logf formats value with args and routes it to Logger().Info.
+//
+// Deprecated: call Logger().Info directly; Logf is kept so code written
+// against the pre-structured-logging API keeps compiling.
+func (lP LogProvider) Logf(value string, args ...interface{}) {
+	lP.shim(LevelInfo, fmt.Sprintf(value, args...), nil)
+}
+
+// LogUsing ignores logFn and routes value to Logger().Debug.
+//
+// Deprecated: call Logger().Debug directly; LogUsing is kept so code written
+// against the pre-structured-logging LogFn API keeps compiling.
+func (lP LogProvider) LogUsing(logFn LogFn, value string, args ...interface{}) {
+	lP.shim(LevelDebug, value, args)
+}
+
+// LogfUsing ignores logFn and routes the formatted value to Logger().Debug.
+//
+// Deprecated: call Logger().Debug directly; LogfUsing is kept so code
+// written against the pre-structured-logging LogFormatFn API keeps
+// compiling.
+func (lP LogProvider) LogfUsing(logFn LogFormatFn, value string, args ...interface{}) {
+	lP.shim(LevelDebug, fmt.Sprintf(value, args...), nil)
+}
+
+func (lP LogProvider) shim(level Level, msg string, keyvals []interface{}) {
+	l := lP.logger
+	if l == nil {
+		l = rootLogger
+	}
+
+	if sl, ok := l.(*stdLogger); ok {
+		sl.shimLog(level, msg, keyvals)
+		return
+	}
+
+	switch level {
+	case LevelDebug:
+		l.Debug(msg, keyvals...)
+	case LevelWarn:
+		l.Warn(msg, keyvals...)
+	case LevelError:
+		l.Error(msg, keyvals...)
+	default:
+		l.Info(msg, keyvals...)
+	}
+}
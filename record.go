@@ -0,0 +1,21 @@
+package blacksmith
+
+import "time"
+
+// CallerInfo identifies the source location that produced a Record.
+type CallerInfo struct {
+	File string `json:"file,omitempty"`
+	Line int    `json:"line,omitempty"`
+}
+
+// Record is a single log event handed to a Handler.
+type Record struct {
+	Time  time.Time `json:"time"`
+	Level Level     `json:"level"`
+	Msg   string    `json:"msg"`
+	// Ctx holds the accumulated key/value pairs from Logger.With calls
+	// followed by the ones passed directly to the logging call, in that
+	// order.
+	Ctx  []interface{} `json:"ctx,omitempty"`
+	Call CallerInfo    `json:"call,omitempty"`
+}
@@ -0,0 +1,146 @@
+// Package run coordinates the lifecycle of multiple long-running components
+// - one or more Blacksmith instances, HTTP servers, metric exporters, and so
+// on - so a program doesn't have to hand-roll goroutine/signal plumbing at
+// every call site. It's modeled after SkyWalking BanyanDB's run module: each
+// Component passes through the same four phases, and a Group drives them
+// together.
+package run
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Component is a long-running piece of a larger program that a Group can
+// coordinate through a shared lifecycle: PreRun (dependency wiring), Serve
+// (blocking work, run concurrently with the other components), and
+// GracefulStop (reverse order, bounded by a deadline).
+type Component interface {
+	// Name identifies the component in errors and logs.
+	Name() string
+	// PreRun wires up anything the component needs before Serve is called,
+	// e.g. dependencies on other components that have already run Config.
+	PreRun() error
+	// Serve performs the component's blocking work. It returns when the
+	// component stops, whether due to GracefulStop or its own completion.
+	Serve() error
+	// GracefulStop asks the component to stop. It should return once the
+	// component has wound down, but Group will not wait past its configured
+	// timeout regardless.
+	GracefulStop()
+}
+
+// Configurable is implemented by a Component that needs to register flags or
+// validate configuration before PreRun runs on any component. It's optional;
+// components that don't need it can skip implementing it.
+type Configurable interface {
+	Config() error
+}
+
+// Group coordinates a set of Components through Config, PreRun, Serve, and
+// GracefulStop.
+type Group struct {
+	components  []Component
+	stopTimeout time.Duration
+}
+
+// New returns a Group that bounds each component's GracefulStop phase by
+// stopTimeout.
+func New(stopTimeout time.Duration) *Group {
+	return &Group{stopTimeout: stopTimeout}
+}
+
+// Add registers c with the Group, to be run in the order Add was called.
+func (g *Group) Add(c Component) *Group {
+	g.components = append(g.components, c)
+	return g
+}
+
+// Run executes Config, PreRun, and Serve across every registered Component,
+// then GracefulStop in reverse registration order. Serve runs all
+// components concurrently; the first one to return, a SIGINT, or a SIGTERM
+// triggers GracefulStop on every component. Run blocks until every component has
+// stopped and returns the first non-nil Serve error, if any.
+func (g *Group) Run() error {
+	for _, c := range g.components {
+		if cfg, ok := c.(Configurable); ok {
+			if err := cfg.Config(); err != nil {
+				return fmt.Errorf("run: %s: config: %w", c.Name(), err)
+			}
+		}
+	}
+
+	for i, c := range g.components {
+		if err := c.PreRun(); err != nil {
+			g.gracefulStop(g.components[:i])
+			return fmt.Errorf("run: %s: pre-run: %w", c.Name(), err)
+		}
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sig)
+
+	errs := make(chan error, len(g.components))
+	var wg sync.WaitGroup
+	for _, c := range g.components {
+		wg.Add(1)
+		go func(c Component) {
+			defer wg.Done()
+			errs <- c.Serve()
+		}(c)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	var firstErr error
+	select {
+	case firstErr = <-errs:
+	case <-sig:
+	case <-done:
+	}
+
+	g.gracefulStop(g.components)
+	<-done
+
+	for {
+		select {
+		case err := <-errs:
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+		default:
+			return firstErr
+		}
+	}
+}
+
+// gracefulStop calls GracefulStop on every component in components, in
+// reverse order, each bounded by g.stopTimeout so a stuck component cannot
+// block shutdown forever. components is normally every registered
+// component, but Run passes a prefix when a PreRun failure means only the
+// components before it ever ran.
+func (g *Group) gracefulStop(components []Component) {
+	for i := len(components) - 1; i >= 0; i-- {
+		c := components[i]
+
+		stopped := make(chan struct{})
+		go func() {
+			c.GracefulStop()
+			close(stopped)
+		}()
+
+		select {
+		case <-stopped:
+		case <-time.After(g.stopTimeout):
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package run
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+type fakeComponent struct {
+	name       string
+	preRunErr  error
+	preRunHit  bool
+	serveErr   error
+	serveBlock chan struct{}
+
+	mu            *sync.Mutex
+	gracefulOrder *[]string
+	gracefulHit   *bool
+}
+
+func (f *fakeComponent) Name() string { return f.name }
+
+func (f *fakeComponent) PreRun() error {
+	f.preRunHit = true
+	return f.preRunErr
+}
+
+func (f *fakeComponent) Serve() error {
+	if f.serveBlock != nil {
+		<-f.serveBlock
+	}
+	return f.serveErr
+}
+
+func (f *fakeComponent) GracefulStop() {
+	if f.gracefulHit != nil {
+		*f.gracefulHit = true
+	}
+	if f.mu != nil {
+		f.mu.Lock()
+		*f.gracefulOrder = append(*f.gracefulOrder, f.name)
+		f.mu.Unlock()
+	}
+	if f.serveBlock != nil {
+		close(f.serveBlock)
+	}
+}
+
+// configurableComponent adds a Config phase on top of fakeComponent, for
+// tests that need to exercise the optional Configurable interface.
+type configurableComponent struct {
+	fakeComponent
+	configErr error
+}
+
+func (c *configurableComponent) Config() error { return c.configErr }
+
+// TestRunGracefulStopsPreRunPrefixOnFailure guards against a regression
+// where a PreRun failure returned immediately without calling GracefulStop
+// on components whose PreRun had already succeeded, leaking whatever they
+// acquired.
+func TestRunGracefulStopsPreRunPrefixOnFailure(t *testing.T) {
+	var aStopped bool
+	a := &fakeComponent{name: "a", gracefulHit: &aStopped}
+	b := &fakeComponent{name: "b", preRunErr: errors.New("boom")}
+
+	g := New(50 * time.Millisecond).Add(a).Add(b)
+
+	if err := g.Run(); err == nil {
+		t.Fatal("expected Run to return b's pre-run error")
+	}
+	if !aStopped {
+		t.Fatal("expected GracefulStop to be called on a, whose PreRun already succeeded")
+	}
+}
+
+// TestRunStopsComponentsInReverseOrderOnServeReturn checks the documented
+// Serve phase sequencing: the first Serve to return triggers GracefulStop on
+// every component, in reverse registration order.
+func TestRunStopsComponentsInReverseOrderOnServeReturn(t *testing.T) {
+	var mu sync.Mutex
+	var order []string
+
+	a := &fakeComponent{name: "a", serveBlock: make(chan struct{}), mu: &mu, gracefulOrder: &order}
+	b := &fakeComponent{name: "b", mu: &mu, gracefulOrder: &order} // returns immediately, triggering shutdown
+
+	g := New(50 * time.Millisecond).Add(a).Add(b)
+
+	if err := g.Run(); err != nil {
+		t.Fatalf("expected Run to return nil, got %v", err)
+	}
+
+	if len(order) != 2 || order[0] != "b" || order[1] != "a" {
+		t.Fatalf("expected GracefulStop order [b a], got %v", order)
+	}
+}
+
+// TestRunConfigFailureSkipsPreRunAndServe checks the documented phase
+// ordering: a Config error on one component stops Run before PreRun or
+// Serve runs on any component, including ones registered earlier.
+func TestRunConfigFailureSkipsPreRunAndServe(t *testing.T) {
+	a := &configurableComponent{fakeComponent: fakeComponent{name: "a"}}
+	b := &configurableComponent{fakeComponent: fakeComponent{name: "b"}, configErr: errors.New("bad config")}
+
+	g := New(50 * time.Millisecond).Add(a).Add(b)
+
+	if err := g.Run(); err == nil {
+		t.Fatal("expected Run to return b's config error")
+	}
+	if a.preRunHit {
+		t.Fatal("expected PreRun not to run on any component after a Config failure")
+	}
+}
+
+// TestRunSignalTriggersGracefulStop checks that a SIGINT delivered to the
+// process, not just a Serve return, drives the same GracefulStop sequence.
+func TestRunSignalTriggersGracefulStop(t *testing.T) {
+	var mu sync.Mutex
+	var order []string
+
+	a := &fakeComponent{name: "a", serveBlock: make(chan struct{}), mu: &mu, gracefulOrder: &order}
+
+	g := New(200 * time.Millisecond).Add(a)
+
+	done := make(chan error, 1)
+	go func() { done <- g.Run() }()
+
+	time.Sleep(20 * time.Millisecond) // let Serve start and signal.Notify register
+	if err := syscall.Kill(os.Getpid(), syscall.SIGINT); err != nil {
+		t.Fatalf("sending SIGINT: %v", err)
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("expected Run to return nil, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for Run to return after SIGINT")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(order) != 1 || order[0] != "a" {
+		t.Fatalf("expected GracefulStop to be called on a after SIGINT, got %v", order)
+	}
+}
@@ -0,0 +1,262 @@
+package blacksmith
+
+import "sync/atomic"
+
+// Default sizes for the internal status/event channels. Both are declared
+// generously since sends to either are non-blocking - a full channel just
+// drops the message rather than stalling a worker.
+const (
+	defaultStatusBuffer = 64
+	defaultEventBuffer  = 64
+)
+
+// workerSession tracks a Worker's declared capabilities and task counters
+// for the lifetime it's registered with a Blacksmith, from start until it
+// stops.
+type workerSession struct {
+	capabilities []TaskName
+	assigned     int
+	completed    int
+	failed       int
+}
+
+// assignment records which worker a queued task was last handed to, and how
+// many times it's been attempted in total.
+type assignment struct {
+	workerID string
+	attempt  int
+}
+
+// statusKind is the kind of message a Worker sends back to its Blacksmith
+// over the shared status channel as it works a task.
+type statusKind int
+
+// The statuses a Worker reports for a task, in the order they're expected
+// to occur.
+const (
+	statusAck statusKind = iota
+	statusProgress
+	statusDone
+	statusFailed
+)
+
+// statusMsg is a single status report from a Worker about a Task it's
+// handling.
+type statusMsg struct {
+	workerID string
+	taskID   string
+	kind     statusKind
+	detail   string
+	err      error
+}
+
+// EventKind identifies what a subscriber-facing Event represents.
+type EventKind int
+
+// EventTaskFailed is emitted once a task has exhausted MaxAttempts after
+// repeated worker crashes.
+const EventTaskFailed EventKind = iota
+
+// Event is emitted on the channel returned by Blacksmith.Events, surfacing
+// things a TaskHandler's lack of a return value can't: currently just a
+// task that failed permanently.
+type Event struct {
+	Kind     EventKind
+	TaskID   string
+	TaskName TaskName
+	Attempt  int
+	Err      error
+}
+
+// Events returns a channel of Events emitted by this Blacksmith. The
+// channel is buffered; a slow consumer causes events to be dropped rather
+// than blocking task dispatch.
+func (b *Blacksmith) Events() <-chan Event {
+	return b.events
+}
+
+// WorkerStats summarizes the tasks a single worker session has handled.
+type WorkerStats struct {
+	Capabilities []TaskName
+	Assigned     int
+	Completed    int
+	Failed       int
+}
+
+// Stats summarizes the current state of a Blacksmith: how many tasks are
+// waiting to be dispatched, how many are currently assigned to a worker,
+// and per-worker counters.
+type Stats struct {
+	QueueDepth int
+	InFlight   int
+	PerWorker  map[string]WorkerStats
+}
+
+// Stats returns a snapshot of the Blacksmith's current queue depth,
+// in-flight assignments, and per-worker task counts.
+func (b *Blacksmith) Stats() Stats {
+	b.assignMu.Lock()
+	inFlight := len(b.assignments)
+	b.assignMu.Unlock()
+
+	b.sessionsMu.Lock()
+	perWorker := make(map[string]WorkerStats, len(b.sessions))
+	for id, s := range b.sessions {
+		capabilities := make([]TaskName, len(s.capabilities))
+		copy(capabilities, s.capabilities)
+
+		perWorker[id] = WorkerStats{
+			Capabilities: capabilities,
+			Assigned:     s.assigned,
+			Completed:    s.completed,
+			Failed:       s.failed,
+		}
+	}
+	b.sessionsMu.Unlock()
+
+	return Stats{
+		QueueDepth: int(atomic.LoadInt64(&b.queueDepth)),
+		InFlight:   inFlight,
+		PerWorker:  perWorker,
+	}
+}
+
+func (b *Blacksmith) registerSession(workerID string, capabilities []TaskName) {
+	b.sessionsMu.Lock()
+	defer b.sessionsMu.Unlock()
+
+	b.sessions[workerID] = &workerSession{capabilities: capabilities}
+}
+
+func (b *Blacksmith) deregisterSession(workerID string) {
+	b.sessionsMu.Lock()
+	defer b.sessionsMu.Unlock()
+
+	delete(b.sessions, workerID)
+}
+
+func (b *Blacksmith) bumpWorker(workerID string, fn func(*workerSession)) {
+	b.sessionsMu.Lock()
+	defer b.sessionsMu.Unlock()
+
+	if s, ok := b.sessions[workerID]; ok {
+		fn(s)
+	}
+}
+
+// recordAssignment notes that taskID has been handed to workerID, returning
+// the attempt number this represents. The first dispatch of a task is
+// attempt 1; a re-queue after a worker crash increments it.
+func (b *Blacksmith) recordAssignment(taskID, workerID string) int {
+	b.assignMu.Lock()
+	a, ok := b.assignments[taskID]
+	if !ok {
+		a = &assignment{}
+		b.assignments[taskID] = a
+	}
+	a.workerID = workerID
+	a.attempt++
+	attempt := a.attempt
+	b.assignMu.Unlock()
+
+	b.bumpWorker(workerID, func(s *workerSession) { s.assigned++ })
+
+	return attempt
+}
+
+// completeAssignment drops the bookkeeping for a task that finished,
+// successfully or not, crediting the worker that last held it.
+func (b *Blacksmith) completeAssignment(taskID string) {
+	b.assignMu.Lock()
+	a, ok := b.assignments[taskID]
+	if ok {
+		delete(b.assignments, taskID)
+	}
+	b.assignMu.Unlock()
+
+	if ok {
+		b.bumpWorker(a.workerID, func(s *workerSession) { s.completed++ })
+	}
+}
+
+// handleTaskFailure is called when a worker's handler panics while running
+// task. If the task hasn't yet been attempted MaxAttempts times it's
+// re-queued for another worker to pick up; otherwise its assignment is
+// dropped and an EventTaskFailed is emitted with the attempt count and the
+// error that finally killed it.
+func (b *Blacksmith) handleTaskFailure(task Task, taskErr error) {
+	b.assignMu.Lock()
+	a, ok := b.assignments[task.TaskID]
+	attempt := 0
+	workerID := ""
+	if ok {
+		attempt = a.attempt
+		workerID = a.workerID
+	}
+	b.assignMu.Unlock()
+
+	if workerID != "" {
+		b.bumpWorker(workerID, func(s *workerSession) { s.failed++ })
+	}
+
+	if attempt < b.maxAttempts {
+		b.Logger().Warn("requeuing task after worker crash", "task", task.TaskName, "task_id", task.TaskID, "attempt", attempt, "error", taskErr)
+		go func() {
+			select {
+			case b.taskQueue <- task:
+				atomic.AddInt64(&b.queueDepth, 1)
+			case <-b.ctx.Done():
+				b.Logger().Warn("abandoning task, smith stopped before it could be requeued", "task", task.TaskName, "task_id", task.TaskID, "attempt", attempt)
+				b.completeAssignment(task.TaskID)
+				b.emitEvent(Event{Kind: EventTaskFailed, TaskID: task.TaskID, TaskName: task.TaskName, Attempt: attempt, Err: taskErr})
+			}
+		}()
+		return
+	}
+
+	b.Logger().Error("task failed permanently", "task", task.TaskName, "task_id", task.TaskID, "attempt", attempt, "error", taskErr)
+	b.completeAssignment(task.TaskID)
+	b.emitEvent(Event{Kind: EventTaskFailed, TaskID: task.TaskID, TaskName: task.TaskName, Attempt: attempt, Err: taskErr})
+}
+
+func (b *Blacksmith) sendStatus(msg statusMsg) {
+	select {
+	case b.statusCh <- msg:
+	default:
+		b.Logger().Warn("dropped status message, status channel full", "worker", msg.workerID, "task_id", msg.taskID)
+	}
+}
+
+func (b *Blacksmith) emitEvent(e Event) {
+	select {
+	case b.events <- e:
+	default:
+		b.Logger().Warn("dropped event, events channel full", "task_id", e.TaskID)
+	}
+}
+
+// processStatus logs every status message a Worker reports, until the
+// Blacksmith's context is cancelled.
+func (b *Blacksmith) processStatus() {
+	for {
+		select {
+		case msg := <-b.statusCh:
+			b.logStatus(msg)
+		case <-b.ctx.Done():
+			return
+		}
+	}
+}
+
+func (b *Blacksmith) logStatus(msg statusMsg) {
+	switch msg.kind {
+	case statusAck:
+		b.Logger().Debug("task acknowledged", "worker", msg.workerID, "task_id", msg.taskID)
+	case statusProgress:
+		b.Logger().Debug("task progress", "worker", msg.workerID, "task_id", msg.taskID, "detail", msg.detail)
+	case statusDone:
+		b.Logger().Debug("task done", "worker", msg.workerID, "task_id", msg.taskID)
+	case statusFailed:
+		b.Logger().Warn("task failed", "worker", msg.workerID, "task_id", msg.taskID, "error", msg.err)
+	}
+}
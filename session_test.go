@@ -0,0 +1,75 @@
+package blacksmith
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// TestHandleTaskFailureRetriesThenEmitsEventTaskFailed exercises the
+// swarmkit-style crash recovery end to end: a handler that always panics
+// should be retried up to MaxAttempts, then reported via Events() instead
+// of being silently dropped.
+func TestHandleTaskFailureRetriesThenEmitsEventTaskFailed(t *testing.T) {
+	b := New(1, WithMaxAttempts(2))
+	b.SetHandlerFn(func(ctx context.Context, task Task) {
+		panic("boom")
+	})
+	b.Run()
+	defer b.Stop(context.Background())
+
+	taskID, err := b.QueueTask(TaskName(0), nil)
+	if err != nil {
+		t.Fatalf("QueueTask: %v", err)
+	}
+
+	select {
+	case ev := <-b.Events():
+		if ev.Kind != EventTaskFailed {
+			t.Fatalf("expected EventTaskFailed, got %v", ev.Kind)
+		}
+		if ev.TaskID != taskID {
+			t.Fatalf("expected event for task %s, got %s", taskID, ev.TaskID)
+		}
+		if ev.Attempt != 2 {
+			t.Fatalf("expected the task to have been attempted MaxAttempts (2) times, got %d", ev.Attempt)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for EventTaskFailed")
+	}
+
+	stats := b.Stats()
+	if stats.InFlight != 0 {
+		t.Fatalf("expected no in-flight assignments once the task gave up permanently, got %d", stats.InFlight)
+	}
+	for workerID, ws := range stats.PerWorker {
+		if ws.Failed != 2 {
+			t.Fatalf("expected worker %s to have 2 recorded failures, got %d", workerID, ws.Failed)
+		}
+	}
+}
+
+// TestStatsCapabilitiesAreNotAliased guards against a regression where
+// Stats returned WorkerStats.Capabilities sharing the same backing array as
+// the session's own capabilities, letting a caller mutate it.
+func TestStatsCapabilitiesAreNotAliased(t *testing.T) {
+	b := New(1, WithCapabilities(TaskName(1), TaskName(2)))
+	b.Run()
+	defer b.Stop(context.Background())
+
+	time.Sleep(10 * time.Millisecond) // let the worker goroutine start; Run has already registered its session
+
+	stats := b.Stats()
+	for _, ws := range stats.PerWorker {
+		if len(ws.Capabilities) > 0 {
+			ws.Capabilities[0] = TaskName(999)
+		}
+	}
+
+	stats = b.Stats()
+	for _, ws := range stats.PerWorker {
+		if len(ws.Capabilities) > 0 && ws.Capabilities[0] == TaskName(999) {
+			t.Fatal("expected mutating a previous Stats() result not to affect a later one")
+		}
+	}
+}
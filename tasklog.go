@@ -0,0 +1,211 @@
+package blacksmith
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+)
+
+// LogRecord is the public name for a captured log Record, returned from
+// TaskLog and streamed from StreamTaskLog.
+type LogRecord = Record
+
+// Defaults used when a Blacksmith is built without WithTaskLogCapacity or
+// WithMaxTaskLogs.
+const (
+	defaultTaskLogCapacity = 100
+	defaultMaxTaskLogs     = 1000
+)
+
+// taskLog is a bounded, ring-buffered capture of a single task's log
+// output, along with any subscribers currently following it via
+// Blacksmith.StreamTaskLog. It implements Handler so it can be teed in
+// alongside a Blacksmith's normal handler.
+type taskLog struct {
+	mu       sync.Mutex
+	records  []LogRecord
+	next     int
+	full     bool
+	capacity int
+	subs     map[chan LogRecord]struct{}
+}
+
+func newTaskLog(capacity int) *taskLog {
+	return &taskLog{
+		records:  make([]LogRecord, capacity),
+		capacity: capacity,
+		subs:     make(map[chan LogRecord]struct{}),
+	}
+}
+
+// Log implements Handler. It appends r to the ring buffer, overwriting the
+// oldest entry once full, and fans it out to any active subscribers.
+func (t *taskLog) Log(r LogRecord) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.records[t.next] = r
+	t.next = (t.next + 1) % t.capacity
+	if t.next == 0 {
+		t.full = true
+	}
+
+	// Sends are non-blocking, so holding mu through them can't stall; it
+	// keeps unsubscribe from closing a channel while it's being sent on.
+	for ch := range t.subs {
+		select {
+		case ch <- r:
+		default:
+		}
+	}
+
+	return nil
+}
+
+// snapshot returns the currently buffered records in chronological order.
+func (t *taskLog) snapshot() []LogRecord {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.full {
+		out := make([]LogRecord, t.next)
+		copy(out, t.records[:t.next])
+		return out
+	}
+
+	out := make([]LogRecord, t.capacity)
+	copy(out, t.records[t.next:])
+	copy(out[t.capacity-t.next:], t.records[:t.next])
+	return out
+}
+
+func (t *taskLog) subscribe() chan LogRecord {
+	ch := make(chan LogRecord, t.capacity)
+
+	t.mu.Lock()
+	t.subs[ch] = struct{}{}
+	t.mu.Unlock()
+
+	return ch
+}
+
+func (t *taskLog) unsubscribe(ch chan LogRecord) {
+	t.mu.Lock()
+	delete(t.subs, ch)
+	t.mu.Unlock()
+
+	close(ch)
+}
+
+// taskLogStore retains a bounded number of taskLogs keyed by task id,
+// evicting the least-recently-touched one once maxTasks is exceeded.
+type taskLogStore struct {
+	mu       sync.Mutex
+	capacity int
+	maxTasks int
+	order    *list.List
+	elems    map[string]*list.Element
+}
+
+type taskLogEntry struct {
+	id  string
+	log *taskLog
+}
+
+func newTaskLogStore(capacity, maxTasks int) *taskLogStore {
+	return &taskLogStore{
+		capacity: capacity,
+		maxTasks: maxTasks,
+		order:    list.New(),
+		elems:    make(map[string]*list.Element),
+	}
+}
+
+// create allocates a fresh taskLog for id, evicting the least-recently-used
+// entry if the store is over its maxTasks cap. If id already has an entry -
+// e.g. a task being retried after a worker crash runs through create again -
+// the old one is dropped first so it doesn't linger as an orphaned list node
+// that can later take the live entry's place out from under it.
+func (s *taskLogStore) create(id string) *taskLog {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if elem, ok := s.elems[id]; ok {
+		s.order.Remove(elem)
+		delete(s.elems, id)
+	}
+
+	tl := newTaskLog(s.capacity)
+	s.elems[id] = s.order.PushFront(&taskLogEntry{id: id, log: tl})
+
+	for s.order.Len() > s.maxTasks {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.elems, oldest.Value.(*taskLogEntry).id)
+	}
+
+	return tl
+}
+
+// get returns the taskLog for id, marking it most-recently-used.
+func (s *taskLogStore) get(id string) (*taskLog, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	elem, ok := s.elems[id]
+	if !ok {
+		return nil, false
+	}
+	s.order.MoveToFront(elem)
+	return elem.Value.(*taskLogEntry).log, true
+}
+
+func (s *taskLogStore) purge(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	elem, ok := s.elems[id]
+	if !ok {
+		return
+	}
+	s.order.Remove(elem)
+	delete(s.elems, id)
+}
+
+// TaskLog returns the captured log Records for the task with the given id.
+// It returns an error if no log has been captured for that id, e.g. it was
+// never dispatched, was already purged, or was evicted under the retention
+// cap set by WithMaxTaskLogs.
+func (b *Blacksmith) TaskLog(taskID string) ([]LogRecord, error) {
+	tl, ok := b.taskLogs.get(taskID)
+	if !ok {
+		return nil, fmt.Errorf("blacksmith: no log captured for task %s", taskID)
+	}
+	return tl.snapshot(), nil
+}
+
+// StreamTaskLog returns a channel of LogRecords for the task with the given
+// id as they're produced. The channel is closed once ctx is done; callers
+// should keep draining it until then so a slow reader doesn't stall under
+// backpressure (new records are dropped, not blocked on, once the channel's
+// buffer is full).
+func (b *Blacksmith) StreamTaskLog(ctx context.Context, taskID string) (<-chan LogRecord, error) {
+	tl, ok := b.taskLogs.get(taskID)
+	if !ok {
+		return nil, fmt.Errorf("blacksmith: no log captured for task %s", taskID)
+	}
+
+	ch := tl.subscribe()
+	go func() {
+		<-ctx.Done()
+		tl.unsubscribe(ch)
+	}()
+
+	return ch, nil
+}
+
+// PurgeTaskLog releases the captured log for the given task id, if any.
+func (b *Blacksmith) PurgeTaskLog(taskID string) {
+	b.taskLogs.purge(taskID)
+}
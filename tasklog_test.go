@@ -0,0 +1,47 @@
+package blacksmith
+
+import "testing"
+
+// TestTaskLogStoreCreateReplacesExistingEntry guards against a regression
+// where calling create twice for the same id - as happens when a task is
+// retried after a worker crash - left a stale, orphaned list node alongside
+// the live one, so order.Len() grew without a matching elems entry.
+func TestTaskLogStoreCreateReplacesExistingEntry(t *testing.T) {
+	s := newTaskLogStore(10, 10)
+
+	first := s.create("task-1")
+	second := s.create("task-1")
+
+	if second == first {
+		t.Fatal("expected create to allocate a fresh taskLog on retry")
+	}
+	if got := s.order.Len(); got != 1 {
+		t.Fatalf("expected a single list entry for task-1, got %d", got)
+	}
+	if got, ok := s.get("task-1"); !ok || got != second {
+		t.Fatal("expected get to return the most recently created taskLog")
+	}
+}
+
+// TestTaskLogStoreCreateRetryUnderEvictionCap guards against a regression
+// where a retried task's stale node, once evicted from the back of the LRU
+// list, deleted the live entry from the lookup map while the live node
+// stayed in the list - making it permanently unreachable via get.
+func TestTaskLogStoreCreateRetryUnderEvictionCap(t *testing.T) {
+	s := newTaskLogStore(10, 2)
+
+	s.create("task-1")
+	s.create("task-1") // simulate a retry before any other task is created
+	s.create("task-2")
+	s.create("task-3") // pushes the store over its cap of 2
+
+	if _, ok := s.get("task-1"); ok {
+		t.Fatal("expected task-1 to have been evicted")
+	}
+	if _, ok := s.get("task-2"); !ok {
+		t.Fatal("expected task-2 to still be reachable")
+	}
+	if _, ok := s.get("task-3"); !ok {
+		t.Fatal("expected task-3 to still be reachable")
+	}
+}